@@ -0,0 +1,117 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onlineddl
+
+import (
+	"time"
+
+	tcontext "github.com/pingcap/dm/pkg/context"
+	"go.uber.org/zap"
+)
+
+// CleanedEntry describes one online-DDL metadata row considered by
+// CleanupStale, for reporting back to dmctl/HTTP/gRPC callers.
+type CleanedEntry struct {
+	ID          string
+	GhostSchema string
+	GhostTable  string
+	UpdatedAt   time.Time
+	// Removed is false when the entry was only reported, either because
+	// dryRun was set or because probeGhostGone said the ghost table is
+	// still there.
+	Removed bool
+}
+
+// CleanupStale enumerates GhostDDLInfo entries whose UpdatedAt is older
+// than olderThan (entries with an unknown UpdatedAt, e.g. from a backend
+// that can't track it, are always kept), optionally restricted to
+// schemas, and deletes them unless dryRun is set.
+//
+// probeGhostGone, if non-nil, is consulted before deleting an entry so a
+// plugin can confirm against the upstream that the ghost table is
+// actually gone (mirroring TiDB's `admin cleanup table lock`, which also
+// only forgets a lock once it has confirmed the table is no longer
+// locked). A nil probeGhostGone skips that confirmation and cleans up
+// purely by age, which is what a "best effort, gh-ost definitely crashed"
+// operator call wants.
+func (s *Storage) CleanupStale(
+	tctx *tcontext.Context,
+	olderThan time.Duration,
+	schemas []string,
+	dryRun bool,
+	probeGhostGone func(schema, table string) (bool, error),
+) ([]CleanedEntry, error) {
+	entries, err := s.store.ListEntries(tctx)
+	if err != nil {
+		return nil, err
+	}
+
+	schemaFilter := make(map[string]struct{}, len(schemas))
+	for _, sc := range schemas {
+		schemaFilter[sc] = struct{}{}
+	}
+
+	cutoff := time.Now().Add(-olderThan)
+	cleaned := make([]CleanedEntry, 0)
+	for _, entry := range entries {
+		if len(schemaFilter) > 0 {
+			if _, ok := schemaFilter[entry.GhostSchema]; !ok {
+				continue
+			}
+		}
+		if entry.UpdatedAt.IsZero() || entry.UpdatedAt.After(cutoff) {
+			continue
+		}
+
+		result := CleanedEntry{
+			ID:          entry.ID,
+			GhostSchema: entry.GhostSchema,
+			GhostTable:  entry.GhostTable,
+			UpdatedAt:   entry.UpdatedAt,
+		}
+
+		if probeGhostGone != nil {
+			gone, err := probeGhostGone(entry.GhostSchema, entry.GhostTable)
+			if err != nil {
+				return nil, err
+			}
+			if !gone {
+				cleaned = append(cleaned, result)
+				continue
+			}
+		}
+
+		if !dryRun {
+			if err := s.store.Delete(tctx, entry.ID, entry.GhostSchema, entry.GhostTable); err != nil {
+				return nil, err
+			}
+			if entry.ID == s.id {
+				s.Lock()
+				if mSchema, ok := s.ddls[entry.GhostSchema]; ok {
+					delete(mSchema, entry.GhostTable)
+				}
+				s.Unlock()
+			}
+			result.Removed = true
+		}
+
+		tctx.L().Info("cleaned up stale online ddl metadata",
+			zap.String("ghost schema", entry.GhostSchema),
+			zap.String("ghost table", entry.GhostTable),
+			zap.Bool("dry run", dryRun))
+		cleaned = append(cleaned, result)
+	}
+
+	return cleaned, nil
+}
@@ -0,0 +1,159 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onlineddl
+
+import (
+	"testing"
+	"time"
+
+	tcontext "github.com/pingcap/dm/pkg/context"
+	"github.com/pingcap/dm/pkg/log"
+)
+
+// fakeCleanupStore is a minimal MetaStore fixture for CleanupStale: unlike
+// memMetaStore it lets a test stamp arbitrary UpdatedAt values, since
+// CleanupStale's age filter is otherwise untestable (memMetaStore always
+// reports the zero value).
+type fakeCleanupStore struct {
+	memMetaStore
+	entries []MetaEntry
+	deleted []string // "id/ghostSchema/ghostTable"
+}
+
+func newFakeCleanupStore(entries []MetaEntry) *fakeCleanupStore {
+	return &fakeCleanupStore{memMetaStore: *newMemMetaStore(), entries: entries}
+}
+
+func (f *fakeCleanupStore) ListEntries(tctx *tcontext.Context) ([]MetaEntry, error) {
+	return f.entries, nil
+}
+
+func (f *fakeCleanupStore) Delete(tctx *tcontext.Context, id, ghostSchema, ghostTable string) error {
+	f.deleted = append(f.deleted, id+"/"+ghostSchema+"/"+ghostTable)
+	return nil
+}
+
+func newCleanupTestStorage(t *testing.T, store MetaStore) *Storage {
+	t.Helper()
+	logCtx := tcontext.NewContext(nil, log.L())
+	s := &Storage{
+		ddls:   make(map[string]map[string]*GhostDDLInfo),
+		logCtx: logCtx,
+	}
+	s.SetMetaStore(store)
+	return s
+}
+
+func staleEntry(schema, table string, age time.Duration) MetaEntry {
+	return MetaEntry{
+		ID:          "source-1",
+		GhostSchema: schema,
+		GhostTable:  table,
+		Info:        &GhostDDLInfo{Schema: "real_db", Table: table},
+		UpdatedAt:   time.Now().Add(-age),
+	}
+}
+
+func TestCleanupStaleAgeFilter(t *testing.T) {
+	store := newFakeCleanupStore([]MetaEntry{
+		staleEntry("ghost_db", "_old_gho", time.Hour),
+		staleEntry("ghost_db", "_fresh_gho", time.Minute),
+	})
+	s := newCleanupTestStorage(t, store)
+
+	cleaned, err := s.CleanupStale(tcontext.Background(), 10*time.Minute, nil, false, nil)
+	if err != nil {
+		t.Fatalf("CleanupStale: %v", err)
+	}
+	if len(cleaned) != 1 || cleaned[0].GhostTable != "_old_gho" {
+		t.Fatalf("expected only the entry older than the cutoff, got %+v", cleaned)
+	}
+	if !cleaned[0].Removed {
+		t.Fatalf("expected the stale entry to be marked removed")
+	}
+	if len(store.deleted) != 1 || store.deleted[0] != "source-1/ghost_db/_old_gho" {
+		t.Fatalf("expected the stale entry to be deleted from the store, got %+v", store.deleted)
+	}
+}
+
+func TestCleanupStaleDryRun(t *testing.T) {
+	store := newFakeCleanupStore([]MetaEntry{
+		staleEntry("ghost_db", "_old_gho", time.Hour),
+	})
+	s := newCleanupTestStorage(t, store)
+
+	cleaned, err := s.CleanupStale(tcontext.Background(), 10*time.Minute, nil, true, nil)
+	if err != nil {
+		t.Fatalf("CleanupStale: %v", err)
+	}
+	if len(cleaned) != 1 || cleaned[0].Removed {
+		t.Fatalf("expected dry run to report without removing, got %+v", cleaned)
+	}
+	if len(store.deleted) != 0 {
+		t.Fatalf("expected dry run not to delete anything, got %+v", store.deleted)
+	}
+}
+
+func TestCleanupStaleSchemaFilter(t *testing.T) {
+	store := newFakeCleanupStore([]MetaEntry{
+		staleEntry("ghost_db_a", "_t1_gho", time.Hour),
+		staleEntry("ghost_db_b", "_t2_gho", time.Hour),
+	})
+	s := newCleanupTestStorage(t, store)
+
+	cleaned, err := s.CleanupStale(tcontext.Background(), 10*time.Minute, []string{"ghost_db_a"}, false, nil)
+	if err != nil {
+		t.Fatalf("CleanupStale: %v", err)
+	}
+	if len(cleaned) != 1 || cleaned[0].GhostSchema != "ghost_db_a" {
+		t.Fatalf("expected schema filter to keep only ghost_db_a, got %+v", cleaned)
+	}
+	if len(store.deleted) != 1 || store.deleted[0] != "source-1/ghost_db_a/_t1_gho" {
+		t.Fatalf("expected only the matching schema to be deleted, got %+v", store.deleted)
+	}
+}
+
+func TestCleanupStaleProbeGhostGone(t *testing.T) {
+	store := newFakeCleanupStore([]MetaEntry{
+		staleEntry("ghost_db", "_still_there_gho", time.Hour),
+		staleEntry("ghost_db", "_gone_gho", time.Hour),
+	})
+	s := newCleanupTestStorage(t, store)
+
+	probe := func(schema, table string) (bool, error) {
+		return table == "_gone_gho", nil
+	}
+
+	cleaned, err := s.CleanupStale(tcontext.Background(), 10*time.Minute, nil, false, probe)
+	if err != nil {
+		t.Fatalf("CleanupStale: %v", err)
+	}
+	if len(cleaned) != 2 {
+		t.Fatalf("expected both entries to be reported, got %+v", cleaned)
+	}
+
+	byTable := make(map[string]CleanedEntry, len(cleaned))
+	for _, c := range cleaned {
+		byTable[c.GhostTable] = c
+	}
+	if byTable["_still_there_gho"].Removed {
+		t.Fatalf("expected the still-present ghost table to be reported but not removed")
+	}
+	if !byTable["_gone_gho"].Removed {
+		t.Fatalf("expected the confirmed-gone ghost table to be removed")
+	}
+	if len(store.deleted) != 1 || store.deleted[0] != "source-1/ghost_db/_gone_gho" {
+		t.Fatalf("expected only the probed-gone entry to be deleted, got %+v", store.deleted)
+	}
+}
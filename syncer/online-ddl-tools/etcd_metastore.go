@@ -0,0 +1,148 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onlineddl
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	tcontext "github.com/pingcap/dm/pkg/context"
+)
+
+// EtcdClient is the subset of *clientv3.Client (shared with dm-master) that
+// NewEtcdMetaStore needs. Keeping it narrow means this package does not
+// have to import etcd's client directly, and a worker embedding
+// dm-master's client can satisfy it without an adapter.
+type EtcdClient interface {
+	Put(tctx *tcontext.Context, key, val string) error
+	Get(tctx *tcontext.Context, key string, prefix bool) (map[string]string, error)
+	Delete(tctx *tcontext.Context, key string, prefix bool) error
+}
+
+// etcdMetaStore keeps online ddl metadata under an etcd prefix instead of a
+// downstream MySQL table, so it stays observable from dm-master (e.g. for
+// "cleanup orphan ghost metadata across all subtasks") without the syncer
+// needing write access to the sink at all.
+type etcdMetaStore struct {
+	cli    EtcdClient
+	prefix string // e.g. /dm-worker/online-ddl/<task-name>/
+}
+
+// NewEtcdMetaStore builds an etcd-backed MetaStore rooted at prefix. cli is
+// expected to be dm-worker's existing connection to the dm-master cluster.
+func NewEtcdMetaStore(cli EtcdClient, prefix string) MetaStore {
+	return &etcdMetaStore{cli: cli, prefix: prefix}
+}
+
+func (e *etcdMetaStore) key(id, ghostSchema, ghostTable string) string {
+	return fmt.Sprintf("%s%s/%s/%s", e.prefix, id, ghostSchema, ghostTable)
+}
+
+// Init implements MetaStore.Init, there's nothing to provision in etcd.
+func (e *etcdMetaStore) Init(tctx *tcontext.Context) error {
+	return nil
+}
+
+// Load implements MetaStore.Load.
+func (e *etcdMetaStore) Load(tctx *tcontext.Context, id string) (map[string]map[string]*GhostDDLInfo, error) {
+	idPrefix := fmt.Sprintf("%s%s/", e.prefix, id)
+	kvs, err := e.cli.Get(tctx, idPrefix, true)
+	if err != nil {
+		return nil, err
+	}
+
+	ddls := make(map[string]map[string]*GhostDDLInfo)
+	for key, raw := range kvs {
+		// key is <prefix><id>/<ghostSchema>/<ghostTable>
+		parts := strings.Split(strings.TrimPrefix(key, idPrefix), "/")
+		if len(parts) != 2 {
+			continue
+		}
+		info := &GhostDDLInfo{}
+		if err := json.Unmarshal([]byte(raw), info); err != nil {
+			return nil, err
+		}
+		mSchema, ok := ddls[parts[0]]
+		if !ok {
+			mSchema = make(map[string]*GhostDDLInfo)
+			ddls[parts[0]] = mSchema
+		}
+		mSchema[parts[1]] = info
+	}
+	return ddls, nil
+}
+
+// ListEntries implements MetaStore.ListEntries.
+//
+// TODO: etcd stores a per-key ModRevision, not a wall-clock time, and the
+// narrow EtcdClient interface above doesn't surface it yet. Until it does,
+// every entry comes back with a zero UpdatedAt, and CleanupStale keeps
+// every entry with a zero UpdatedAt, so it neither reports nor removes
+// anything from this backend.
+func (e *etcdMetaStore) ListEntries(tctx *tcontext.Context) ([]MetaEntry, error) {
+	kvs, err := e.cli.Get(tctx, e.prefix, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []MetaEntry
+	for key, raw := range kvs {
+		// key is <prefix><id>/<ghostSchema>/<ghostTable>
+		parts := strings.Split(strings.TrimPrefix(key, e.prefix), "/")
+		if len(parts) != 3 {
+			continue
+		}
+		info := &GhostDDLInfo{}
+		if err := json.Unmarshal([]byte(raw), info); err != nil {
+			return nil, err
+		}
+		entries = append(entries, MetaEntry{
+			ID:          parts[0],
+			GhostSchema: parts[1],
+			GhostTable:  parts[2],
+			Info:        info,
+		})
+	}
+	return entries, nil
+}
+
+// Save implements MetaStore.Save.
+func (e *etcdMetaStore) Save(tctx *tcontext.Context, id, ghostSchema, ghostTable string, info *GhostDDLInfo) error {
+	raw, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return e.cli.Put(tctx, e.key(id, ghostSchema, ghostTable), string(raw))
+}
+
+// Delete implements MetaStore.Delete.
+func (e *etcdMetaStore) Delete(tctx *tcontext.Context, id, ghostSchema, ghostTable string) error {
+	return e.cli.Delete(tctx, e.key(id, ghostSchema, ghostTable), false)
+}
+
+// Clear implements MetaStore.Clear.
+func (e *etcdMetaStore) Clear(tctx *tcontext.Context, id string) error {
+	return e.cli.Delete(tctx, fmt.Sprintf("%s%s/", e.prefix, id), true)
+}
+
+// ResetConn implements MetaStore.ResetConn, the shared etcd client manages
+// its own reconnection.
+func (e *etcdMetaStore) ResetConn(tctx *tcontext.Context) error {
+	return nil
+}
+
+// Close implements MetaStore.Close, the etcd client is owned by whoever
+// constructed it (dm-worker), not by this MetaStore.
+func (e *etcdMetaStore) Close() {}
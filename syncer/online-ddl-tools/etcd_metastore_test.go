@@ -0,0 +1,139 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onlineddl
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	tcontext "github.com/pingcap/dm/pkg/context"
+)
+
+// fakeEtcdClient is a minimal in-memory stand-in for EtcdClient, enough to
+// exercise etcdMetaStore without a real etcd cluster.
+type fakeEtcdClient struct {
+	sync.Mutex
+	kvs map[string]string
+}
+
+func newFakeEtcdClient() *fakeEtcdClient {
+	return &fakeEtcdClient{kvs: make(map[string]string)}
+}
+
+func (c *fakeEtcdClient) Put(tctx *tcontext.Context, key, val string) error {
+	c.Lock()
+	defer c.Unlock()
+	c.kvs[key] = val
+	return nil
+}
+
+func (c *fakeEtcdClient) Get(tctx *tcontext.Context, key string, prefix bool) (map[string]string, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	out := make(map[string]string)
+	if !prefix {
+		if v, ok := c.kvs[key]; ok {
+			out[key] = v
+		}
+		return out, nil
+	}
+	for k, v := range c.kvs {
+		if strings.HasPrefix(k, key) {
+			out[k] = v
+		}
+	}
+	return out, nil
+}
+
+func (c *fakeEtcdClient) Delete(tctx *tcontext.Context, key string, prefix bool) error {
+	c.Lock()
+	defer c.Unlock()
+
+	if !prefix {
+		delete(c.kvs, key)
+		return nil
+	}
+	for k := range c.kvs {
+		if strings.HasPrefix(k, key) {
+			delete(c.kvs, k)
+		}
+	}
+	return nil
+}
+
+func TestEtcdMetaStoreLifecycle(t *testing.T) {
+	cli := newFakeEtcdClient()
+	store := NewEtcdMetaStore(cli, "/dm-worker/online-ddl/task1/")
+	tctx := tcontext.Background()
+
+	if err := store.Init(tctx); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+
+	ddls, err := store.Load(tctx, "source-1")
+	if err != nil {
+		t.Fatalf("Load (empty): %v", err)
+	}
+	if len(ddls) != 0 {
+		t.Fatalf("expected no entries before any Save, got %+v", ddls)
+	}
+
+	info := &GhostDDLInfo{Schema: "real_db", Table: "t1", DDLs: []string{"ALTER TABLE t1 ADD COLUMN c1 INT"}}
+	if err := store.Save(tctx, "source-1", "ghost_db", "_t1_gho", info); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	ddls, err = store.Load(tctx, "source-1")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got := ddls["ghost_db"]["_t1_gho"]; got == nil || got.Table != "t1" {
+		t.Fatalf("unexpected loaded entry: %+v", ddls)
+	}
+
+	entries, err := store.ListEntries(tctx)
+	if err != nil {
+		t.Fatalf("ListEntries: %v", err)
+	}
+	if len(entries) != 1 || entries[0].ID != "source-1" || entries[0].GhostTable != "_t1_gho" {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+
+	if err := store.Delete(tctx, "source-1", "ghost_db", "_t1_gho"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	ddls, err = store.Load(tctx, "source-1")
+	if err != nil {
+		t.Fatalf("Load after Delete: %v", err)
+	}
+	if len(ddls) != 0 {
+		t.Fatalf("expected entry to be gone after Delete, got %+v", ddls)
+	}
+
+	if err := store.Save(tctx, "source-1", "ghost_db", "_t2_gho", info); err != nil {
+		t.Fatalf("Save (for Clear): %v", err)
+	}
+	if err := store.Clear(tctx, "source-1"); err != nil {
+		t.Fatalf("Clear: %v", err)
+	}
+	ddls, err = store.Load(tctx, "source-1")
+	if err != nil {
+		t.Fatalf("Load after Clear: %v", err)
+	}
+	if len(ddls) != 0 {
+		t.Fatalf("expected no entries after Clear, got %+v", ddls)
+	}
+}
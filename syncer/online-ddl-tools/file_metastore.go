@@ -0,0 +1,203 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onlineddl
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	tcontext "github.com/pingcap/dm/pkg/context"
+)
+
+// fileMetaStore persists online ddl metadata as one JSON file per source ID
+// under dir. It's meant for dmctl-only/embedded use, where DM isn't running
+// against a shared downstream or etcd cluster at all.
+type fileMetaStore struct {
+	sync.Mutex
+	dir string
+}
+
+// NewFileMetaStore builds a MetaStore that stores its state under dir, one
+// JSON file per source ID.
+func NewFileMetaStore(dir string) MetaStore {
+	return &fileMetaStore{dir: dir}
+}
+
+func (f *fileMetaStore) path(id string) string {
+	return filepath.Join(f.dir, id+".json")
+}
+
+// Init implements MetaStore.Init.
+func (f *fileMetaStore) Init(tctx *tcontext.Context) error {
+	return os.MkdirAll(f.dir, 0o755)
+}
+
+// Load implements MetaStore.Load.
+func (f *fileMetaStore) Load(tctx *tcontext.Context, id string) (map[string]map[string]*GhostDDLInfo, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	ddls := make(map[string]map[string]*GhostDDLInfo)
+	raw, err := ioutil.ReadFile(f.path(id))
+	if os.IsNotExist(err) {
+		return ddls, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(raw, &ddls); err != nil {
+		return nil, err
+	}
+	return ddls, nil
+}
+
+// ListEntries implements MetaStore.ListEntries.
+func (f *fileMetaStore) ListEntries(tctx *tcontext.Context) ([]MetaEntry, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	files, err := ioutil.ReadDir(f.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var entries []MetaEntry
+	for _, fi := range files {
+		if fi.IsDir() || !strings.HasSuffix(fi.Name(), ".json") {
+			continue
+		}
+		id := strings.TrimSuffix(fi.Name(), ".json")
+		ddls, err := f.loadLocked(id)
+		if err != nil {
+			return nil, err
+		}
+		for schema, tbls := range ddls {
+			for table, info := range tbls {
+				entries = append(entries, MetaEntry{
+					ID:          id,
+					GhostSchema: schema,
+					GhostTable:  table,
+					Info:        info,
+					UpdatedAt:   fi.ModTime(),
+				})
+			}
+		}
+	}
+	return entries, nil
+}
+
+// Save implements MetaStore.Save.
+func (f *fileMetaStore) Save(tctx *tcontext.Context, id, ghostSchema, ghostTable string, info *GhostDDLInfo) error {
+	f.Lock()
+	defer f.Unlock()
+
+	ddls, err := f.loadLocked(id)
+	if err != nil {
+		return err
+	}
+	mSchema, ok := ddls[ghostSchema]
+	if !ok {
+		mSchema = make(map[string]*GhostDDLInfo)
+		ddls[ghostSchema] = mSchema
+	}
+	mSchema[ghostTable] = info
+	return f.writeLocked(id, ddls)
+}
+
+// Delete implements MetaStore.Delete.
+func (f *fileMetaStore) Delete(tctx *tcontext.Context, id, ghostSchema, ghostTable string) error {
+	f.Lock()
+	defer f.Unlock()
+
+	ddls, err := f.loadLocked(id)
+	if err != nil {
+		return err
+	}
+	if mSchema, ok := ddls[ghostSchema]; ok {
+		delete(mSchema, ghostTable)
+	}
+	return f.writeLocked(id, ddls)
+}
+
+// Clear implements MetaStore.Clear.
+func (f *fileMetaStore) Clear(tctx *tcontext.Context, id string) error {
+	f.Lock()
+	defer f.Unlock()
+
+	err := os.Remove(f.path(id))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// ResetConn implements MetaStore.ResetConn, there's no connection to reset.
+func (f *fileMetaStore) ResetConn(tctx *tcontext.Context) error {
+	return nil
+}
+
+// Close implements MetaStore.Close.
+func (f *fileMetaStore) Close() {}
+
+// loadLocked is like Load but assumes the caller already holds f.Lock.
+func (f *fileMetaStore) loadLocked(id string) (map[string]map[string]*GhostDDLInfo, error) {
+	ddls := make(map[string]map[string]*GhostDDLInfo)
+	raw, err := ioutil.ReadFile(f.path(id))
+	if os.IsNotExist(err) {
+		return ddls, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, &ddls); err != nil {
+		return nil, err
+	}
+	return ddls, nil
+}
+
+// writeLocked persists ddls by writing to a temp file in the same
+// directory and renaming it over the target, so a crash mid-write leaves
+// either the old file or the new one intact, never a truncated one that
+// Load/loadLocked can't parse.
+func (f *fileMetaStore) writeLocked(id string, ddls map[string]map[string]*GhostDDLInfo) error {
+	raw, err := json.Marshal(ddls)
+	if err != nil {
+		return err
+	}
+
+	target := f.path(id)
+	tmp, err := ioutil.TempFile(f.dir, filepath.Base(target)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), target)
+}
@@ -0,0 +1,126 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onlineddl
+
+import (
+	"io/ioutil"
+	"testing"
+
+	tcontext "github.com/pingcap/dm/pkg/context"
+)
+
+func TestFileMetaStoreLifecycle(t *testing.T) {
+	dir := t.TempDir()
+	store := NewFileMetaStore(dir)
+	tctx := tcontext.Background()
+
+	if err := store.Init(tctx); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+
+	ddls, err := store.Load(tctx, "source-1")
+	if err != nil {
+		t.Fatalf("Load (empty): %v", err)
+	}
+	if len(ddls) != 0 {
+		t.Fatalf("expected no entries before any Save, got %+v", ddls)
+	}
+
+	info := &GhostDDLInfo{Schema: "real_db", Table: "t1", DDLs: []string{"ALTER TABLE t1 ADD COLUMN c1 INT"}}
+	if err := store.Save(tctx, "source-1", "ghost_db", "_t1_gho", info); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	ddls, err = store.Load(tctx, "source-1")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got := ddls["ghost_db"]["_t1_gho"]; got == nil || got.Table != "t1" {
+		t.Fatalf("unexpected loaded entry: %+v", got)
+	}
+
+	entries, err := store.ListEntries(tctx)
+	if err != nil {
+		t.Fatalf("ListEntries: %v", err)
+	}
+	if len(entries) != 1 || entries[0].GhostTable != "_t1_gho" {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+	if entries[0].UpdatedAt.IsZero() {
+		t.Fatal("expected ListEntries to stamp UpdatedAt from the file's mtime")
+	}
+
+	if err := store.Delete(tctx, "source-1", "ghost_db", "_t1_gho"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	ddls, err = store.Load(tctx, "source-1")
+	if err != nil {
+		t.Fatalf("Load after Delete: %v", err)
+	}
+	if len(ddls["ghost_db"]) != 0 {
+		t.Fatalf("expected entry to be gone after Delete, got %+v", ddls)
+	}
+
+	if err := store.Save(tctx, "source-1", "ghost_db", "_t2_gho", info); err != nil {
+		t.Fatalf("Save (for Clear): %v", err)
+	}
+	if err := store.Clear(tctx, "source-1"); err != nil {
+		t.Fatalf("Clear: %v", err)
+	}
+	ddls, err = store.Load(tctx, "source-1")
+	if err != nil {
+		t.Fatalf("Load after Clear: %v", err)
+	}
+	if len(ddls) != 0 {
+		t.Fatalf("expected no entries after Clear, got %+v", ddls)
+	}
+}
+
+// TestFileMetaStoreWriteLockedLeavesNoTempFile checks that a Save, which
+// lands via writeLocked's temp-file-then-rename, leaves one parseable
+// target file and no temp file behind. It does not simulate a crash
+// mid-write.
+func TestFileMetaStoreWriteLockedLeavesNoTempFile(t *testing.T) {
+	dir := t.TempDir()
+	store := NewFileMetaStore(dir).(*fileMetaStore)
+	tctx := tcontext.Background()
+	if err := store.Init(tctx); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+
+	info := &GhostDDLInfo{Schema: "real_db", Table: "t1"}
+	if err := store.Save(tctx, "source-1", "ghost_db", "_t1_gho", info); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	files, err := store.ListEntries(tctx)
+	if err != nil {
+		t.Fatalf("ListEntries: %v", err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("expected exactly one entry, got %+v", files)
+	}
+
+	// writeLocked must not leave its temp file behind after a successful
+	// rename.
+	dirEntries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("reading dir: %v", err)
+	}
+	for _, entry := range dirEntries {
+		if entry.Name() != "source-1.json" {
+			t.Fatalf("expected only the target file to remain, also found %q", entry.Name())
+		}
+	}
+}
@@ -0,0 +1,226 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onlineddl
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+
+	tcontext "github.com/pingcap/dm/pkg/context"
+
+	"go.uber.org/zap"
+)
+
+// HookStage is the lifecycle stage a gh-ost/pt-osc hook reports.
+// gh-ost/pt-online-schema-change both support calling out to an external
+// program at these points, see their `--hooks-path`/`--plugin` documentation.
+type HookStage string
+
+// hook stages, named after gh-ost's hook file names.
+const (
+	HookOnStartup       HookStage = "onStartup"
+	HookOnBeforeCutOver HookStage = "onBeforeCutOver"
+	HookOnSuccess       HookStage = "onSuccess"
+	HookOnFailure       HookStage = "onFailure"
+)
+
+// HookPayload is the information gh-ost/pt-osc hand to DM when calling a hook.
+type HookPayload struct {
+	Stage HookStage `json:"stage"`
+
+	GhostSchema string `json:"ghost_schema"`
+	GhostTable  string `json:"ghost_table"`
+	RealSchema  string `json:"real_schema"`
+	RealTable   string `json:"real_table"`
+
+	// ContextID identifies a single gh-ost/pt-osc run, so repeated hook
+	// calls for the same migration can be told apart from a new one
+	// started after a crash.
+	ContextID string `json:"context_id"`
+}
+
+// hookState records the most recent HookPayload observed for a ghost table,
+// so Apply can treat it as an authoritative signal instead of inferring the
+// table's role from its name.
+type hookState struct {
+	// map ghost schema => [ghost table => last hook payload, ...]
+	payloads map[string]map[string]*HookPayload
+}
+
+func newHookState() *hookState {
+	return &hookState{payloads: make(map[string]map[string]*HookPayload)}
+}
+
+// RecordHook saves the payload delivered by a gh-ost/pt-osc hook call.
+// onStartup/onBeforeCutOver persist a GhostDDLInfo entry through
+// Storage.Save (via EnsureGhostEntry) before anything is recorded in
+// memory-only hook state, so the authoritative signal survives a DM
+// restart between hook calls. onSuccess/onFailure delete that entry
+// through Storage.Delete — the same effect Finish has once the migration
+// is done — before clearing the hook bookkeeping, so the payload isn't
+// lost until it has actually been acted on.
+func (s *Storage) RecordHook(tctx *tcontext.Context, payload HookPayload) error {
+	if payload.GhostSchema == "" || payload.GhostTable == "" {
+		return fmt.Errorf("online ddl hook payload missing ghost schema/table: %+v", payload)
+	}
+
+	switch payload.Stage {
+	case HookOnStartup, HookOnBeforeCutOver:
+		if err := s.EnsureGhostEntry(tctx, payload.GhostSchema, payload.GhostTable, payload.RealSchema, payload.RealTable, payload.ContextID); err != nil {
+			return err
+		}
+	case HookOnSuccess, HookOnFailure:
+		if err := s.Delete(tctx, payload.GhostSchema, payload.GhostTable); err != nil {
+			return err
+		}
+	}
+
+	s.Lock()
+	if s.hooks == nil {
+		s.hooks = newHookState()
+	}
+	mSchema, ok := s.hooks.payloads[payload.GhostSchema]
+	if !ok {
+		mSchema = make(map[string]*HookPayload)
+		s.hooks.payloads[payload.GhostSchema] = mSchema
+	}
+	p := payload
+	mSchema[payload.GhostTable] = &p
+	s.Unlock()
+
+	tctx.L().Info("recorded online ddl hook",
+		zap.String("stage", string(payload.Stage)),
+		zap.String("ghost schema", payload.GhostSchema),
+		zap.String("ghost table", payload.GhostTable),
+		zap.String("context id", payload.ContextID))
+
+	switch payload.Stage {
+	case HookOnSuccess, HookOnFailure:
+		// the entry is already gone from the MetaStore above; drop the
+		// hook bookkeeping too so a later run starting on the same ghost
+		// table name does not pick up stale state.
+		return s.clearHook(payload.GhostSchema, payload.GhostTable)
+	default:
+		return nil
+	}
+}
+
+// EnsureGhostEntry makes sure a GhostDDLInfo entry exists (and is
+// persisted through the MetaStore) for a ghost table, without requiring a
+// parsed DDL statement the way Save does. It's what lets a hook call that
+// only carries schema/table names — not DDL text — still make the
+// MetaStore authoritative for TableType/Apply before any binlog-derived
+// DDL has been seen.
+//
+// contextID is the HookPayload.ContextID of the call that triggered this.
+// If an entry already exists for (ghostSchema, ghostTable) but was created
+// by a different, non-empty contextID, it's treated as stale — left over
+// from a gh-ost/pt-osc run that crashed before onSuccess/onFailure cleaned
+// it up — and replaced rather than kept, so the new run doesn't inherit
+// the old run's DDLs. An empty contextID (deployments that don't set one)
+// always keeps the existing entry, matching the previous name-only
+// behavior.
+func (s *Storage) EnsureGhostEntry(tctx *tcontext.Context, ghostSchema, ghostTable, realSchema, realTable, contextID string) error {
+	s.Lock()
+	mSchema, ok := s.ddls[ghostSchema]
+	if !ok {
+		mSchema = make(map[string]*GhostDDLInfo)
+		s.ddls[ghostSchema] = mSchema
+	}
+	if existing, ok := mSchema[ghostTable]; ok {
+		sameRun := contextID == "" || existing.HookContextID == "" || existing.HookContextID == contextID
+		if sameRun {
+			s.Unlock()
+			return nil
+		}
+	}
+	info := &GhostDDLInfo{Schema: realSchema, Table: realTable, Version: ghostDDLInfoVersion, HookContextID: contextID}
+	mSchema[ghostTable] = info
+	s.Unlock()
+
+	return s.store.Save(tctx, s.id, ghostSchema, ghostTable, info)
+}
+
+func (s *Storage) clearHook(ghostSchema, ghostTable string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.hooks == nil {
+		return nil
+	}
+	mSchema, ok := s.hooks.payloads[ghostSchema]
+	if !ok {
+		return nil
+	}
+	delete(mSchema, ghostTable)
+	return nil
+}
+
+// HookHTTPHandler returns the endpoint gh-ost's `--hooks-path`/pt-osc's
+// `--plugin` scripts POST a JSON-encoded HookPayload to, one per lifecycle
+// stage. This is what makes RecordHook reachable from outside the DM
+// process at all: gh-ost/pt-osc invoke hooks by running an external
+// program, not by calling Go code directly.
+func (s *Storage) HookHTTPHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var payload HookPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, fmt.Sprintf("decode hook payload: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		if err := s.RecordHook(s.logCtx, payload); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// ServeHookListener serves the hook HTTP endpoint on l until l is closed
+// or the server fails to start. l is typically a TCP listener bound to a
+// per-subtask port, or a `net.Listen("unix", path)` Unix-socket listener
+// — gh-ost/pt-osc's hooks can call either one. Wiring the configured
+// hooks address/socket path into a listener and running this in a
+// goroutine is left to dm-worker's subtask startup, which isn't part of
+// this snapshot.
+func (s *Storage) ServeHookListener(l net.Listener) error {
+	srv := &http.Server{Handler: s.HookHTTPHandler()}
+	return srv.Serve(l)
+}
+
+// HookState returns the last hook payload recorded for a ghost table, or
+// nil if gh-ost/pt-osc never called a hook for it (e.g. the deployment
+// does not wire up `--hooks-path`/`--plugin`). Callers should fall back to
+// the regex-based TableType when this returns nil.
+func (s *Storage) HookState(ghostSchema, ghostTable string) *HookPayload {
+	s.RLock()
+	defer s.RUnlock()
+
+	if s.hooks == nil {
+		return nil
+	}
+	mSchema, ok := s.hooks.payloads[ghostSchema]
+	if !ok {
+		return nil
+	}
+	return mSchema[ghostTable]
+}
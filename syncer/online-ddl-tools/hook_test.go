@@ -0,0 +1,134 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onlineddl
+
+import (
+	"testing"
+
+	"github.com/pingcap/dm/dm/config"
+	tcontext "github.com/pingcap/dm/pkg/context"
+	"github.com/pingcap/dm/pkg/log"
+)
+
+func newHookTestStorage(t *testing.T) *Storage {
+	t.Helper()
+	logCtx := tcontext.NewContext(nil, log.L())
+	s := &Storage{
+		ddls:   make(map[string]map[string]*GhostDDLInfo),
+		hooks:  newHookState(),
+		sched:  newTableScheduler(),
+		logCtx: logCtx,
+	}
+	s.SetMetaStore(newMemMetaStore())
+	return s
+}
+
+// TestRecordHookResetsOnNewContextID covers the crash-and-restart case:
+// a new gh-ost/pt-osc run reusing the same ghost table name must not
+// silently inherit the previous (crashed) run's entry.
+func TestRecordHookResetsOnNewContextID(t *testing.T) {
+	s := newHookTestStorage(t)
+	tctx := tcontext.Background()
+
+	if err := s.RecordHook(tctx, HookPayload{
+		Stage: HookOnStartup, GhostSchema: "ghost_db", GhostTable: "_t1_gho",
+		RealSchema: "real_db", RealTable: "t1", ContextID: "run-1",
+	}); err != nil {
+		t.Fatalf("RecordHook onStartup run-1: %v", err)
+	}
+	if err := s.Save(tctx, config.GHOST, "ghost_db", "_t1_gho", "real_db", "t1", "ALTER TABLE t1 ADD COLUMN c1 INT"); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	info := s.Get("ghost_db", "_t1_gho")
+	if info == nil || len(info.DDLs) != 1 {
+		t.Fatalf("expected one recorded ddl for run-1, got %+v", info)
+	}
+
+	// run-1 crashes without onSuccess/onFailure; gh-ost starts a fresh
+	// run-2 against the same ghost table name.
+	if err := s.RecordHook(tctx, HookPayload{
+		Stage: HookOnStartup, GhostSchema: "ghost_db", GhostTable: "_t1_gho",
+		RealSchema: "real_db", RealTable: "t1", ContextID: "run-2",
+	}); err != nil {
+		t.Fatalf("RecordHook onStartup run-2: %v", err)
+	}
+
+	info = s.Get("ghost_db", "_t1_gho")
+	if info == nil {
+		t.Fatal("expected an entry for run-2")
+	}
+	if len(info.DDLs) != 0 {
+		t.Fatalf("expected run-2 to reset stale DDLs from run-1, got %+v", info.DDLs)
+	}
+	if info.HookContextID != "run-2" {
+		t.Fatalf("expected entry to be stamped with the new context id, got %q", info.HookContextID)
+	}
+}
+
+// TestRecordHookKeepsEntryForSameContextID covers the normal case: a
+// second onStartup/onBeforeCutOver call for the same run must not wipe
+// DDLs already recorded for it.
+func TestRecordHookKeepsEntryForSameContextID(t *testing.T) {
+	s := newHookTestStorage(t)
+	tctx := tcontext.Background()
+
+	payload := HookPayload{
+		Stage: HookOnStartup, GhostSchema: "ghost_db", GhostTable: "_t1_gho",
+		RealSchema: "real_db", RealTable: "t1", ContextID: "run-1",
+	}
+	if err := s.RecordHook(tctx, payload); err != nil {
+		t.Fatalf("RecordHook onStartup: %v", err)
+	}
+	if err := s.Save(tctx, config.GHOST, "ghost_db", "_t1_gho", "real_db", "t1", "ALTER TABLE t1 ADD COLUMN c1 INT"); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	payload.Stage = HookOnBeforeCutOver
+	if err := s.RecordHook(tctx, payload); err != nil {
+		t.Fatalf("RecordHook onBeforeCutOver: %v", err)
+	}
+
+	info := s.Get("ghost_db", "_t1_gho")
+	if info == nil || len(info.DDLs) != 1 {
+		t.Fatalf("expected the DDL recorded earlier in the same run to survive, got %+v", info)
+	}
+}
+
+// TestRecordHookSuccessDeletesEntry covers onSuccess actually persisting
+// through Delete instead of only clearing the in-memory hook state.
+func TestRecordHookSuccessDeletesEntry(t *testing.T) {
+	s := newHookTestStorage(t)
+	tctx := tcontext.Background()
+
+	if err := s.RecordHook(tctx, HookPayload{
+		Stage: HookOnStartup, GhostSchema: "ghost_db", GhostTable: "_t1_gho",
+		RealSchema: "real_db", RealTable: "t1", ContextID: "run-1",
+	}); err != nil {
+		t.Fatalf("RecordHook onStartup: %v", err)
+	}
+	if err := s.RecordHook(tctx, HookPayload{
+		Stage: HookOnSuccess, GhostSchema: "ghost_db", GhostTable: "_t1_gho",
+		RealSchema: "real_db", RealTable: "t1", ContextID: "run-1",
+	}); err != nil {
+		t.Fatalf("RecordHook onSuccess: %v", err)
+	}
+
+	if got := s.Get("ghost_db", "_t1_gho"); got != nil {
+		t.Fatalf("expected entry to be deleted after onSuccess, got %+v", got)
+	}
+	if got := s.HookState("ghost_db", "_t1_gho"); got != nil {
+		t.Fatalf("expected hook state to be cleared after onSuccess, got %+v", got)
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onlineddl
+
+import (
+	"sync"
+
+	tcontext "github.com/pingcap/dm/pkg/context"
+)
+
+// memMetaStore is an in-memory MetaStore: nothing is written to any sink
+// at all. It exists for driving the Apply/Save/Finish cycle against sinks
+// that can't host a `*_onlineddl` table — e.g. a Kafka or file/BR-style
+// export target where DM otherwise has no writable downstream to keep
+// this bookkeeping in.
+type memMetaStore struct {
+	sync.Mutex
+	entries map[string]map[string]map[string]*GhostDDLInfo // id => ghost schema => ghost table => info
+}
+
+func newMemMetaStore() *memMetaStore {
+	return &memMetaStore{entries: make(map[string]map[string]map[string]*GhostDDLInfo)}
+}
+
+// Init implements MetaStore.Init, there's nothing to provision.
+func (m *memMetaStore) Init(tctx *tcontext.Context) error { return nil }
+
+// Load implements MetaStore.Load.
+func (m *memMetaStore) Load(tctx *tcontext.Context, id string) (map[string]map[string]*GhostDDLInfo, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	ddls := make(map[string]map[string]*GhostDDLInfo)
+	for schema, tbls := range m.entries[id] {
+		mSchema := make(map[string]*GhostDDLInfo, len(tbls))
+		for table, info := range tbls {
+			clone := *info
+			mSchema[table] = &clone
+		}
+		ddls[schema] = mSchema
+	}
+	return ddls, nil
+}
+
+// Save implements MetaStore.Save.
+func (m *memMetaStore) Save(tctx *tcontext.Context, id, ghostSchema, ghostTable string, info *GhostDDLInfo) error {
+	m.Lock()
+	defer m.Unlock()
+
+	byID, ok := m.entries[id]
+	if !ok {
+		byID = make(map[string]map[string]*GhostDDLInfo)
+		m.entries[id] = byID
+	}
+	mSchema, ok := byID[ghostSchema]
+	if !ok {
+		mSchema = make(map[string]*GhostDDLInfo)
+		byID[ghostSchema] = mSchema
+	}
+	clone := *info
+	mSchema[ghostTable] = &clone
+	return nil
+}
+
+// Delete implements MetaStore.Delete.
+func (m *memMetaStore) Delete(tctx *tcontext.Context, id, ghostSchema, ghostTable string) error {
+	m.Lock()
+	defer m.Unlock()
+
+	if mSchema, ok := m.entries[id][ghostSchema]; ok {
+		delete(mSchema, ghostTable)
+	}
+	return nil
+}
+
+// Clear implements MetaStore.Clear.
+func (m *memMetaStore) Clear(tctx *tcontext.Context, id string) error {
+	m.Lock()
+	defer m.Unlock()
+
+	delete(m.entries, id)
+	return nil
+}
+
+// ListEntries implements MetaStore.ListEntries. Entries never age here
+// since nothing stamps an update time in memory; UpdatedAt is always zero,
+// which CleanupStale treats as "unknown, don't age out".
+func (m *memMetaStore) ListEntries(tctx *tcontext.Context) ([]MetaEntry, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	var out []MetaEntry
+	for id, byID := range m.entries {
+		for schema, tbls := range byID {
+			for table, info := range tbls {
+				clone := *info
+				out = append(out, MetaEntry{ID: id, GhostSchema: schema, GhostTable: table, Info: &clone})
+			}
+		}
+	}
+	return out, nil
+}
+
+// ResetConn implements MetaStore.ResetConn, there's no connection to reset.
+func (m *memMetaStore) ResetConn(tctx *tcontext.Context) error { return nil }
+
+// Close implements MetaStore.Close.
+func (m *memMetaStore) Close() {}
@@ -0,0 +1,112 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onlineddl
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pingcap/dm/dm/config"
+	tcontext "github.com/pingcap/dm/pkg/context"
+)
+
+// MetaEntry is one persisted online-DDL record, as returned by
+// MetaStore.ListEntries for admin/cleanup use.
+type MetaEntry struct {
+	ID          string // source ID the entry belongs to
+	GhostSchema string
+	GhostTable  string
+	Info        *GhostDDLInfo
+	// UpdatedAt is when the entry was last written. Backends that can't
+	// track this precisely (e.g. etcdMetaStore today) return the zero
+	// value; callers should treat that as "unknown, don't age out".
+	UpdatedAt time.Time
+}
+
+// MetaStore persists online-DDL metadata (GhostDDLInfo, keyed by source ID
+// and ghost schema/table). The default implementation keeps using a
+// downstream MySQL table as before (mysqlMetaStore), but Storage can be
+// pointed at any other MetaStore via SetMetaStore before Init, e.g. an
+// etcd-backed one shared with dm-master, or a local-file one for
+// dmctl-only/embedded use where there is no writable downstream at all.
+type MetaStore interface {
+	// Init prepares the backend (creating tables/dirs/etc. as needed).
+	Init(tctx *tcontext.Context) error
+	// Load returns all recorded online ddls for the given source ID,
+	// keyed by ghost schema => ghost table => info.
+	Load(tctx *tcontext.Context, id string) (map[string]map[string]*GhostDDLInfo, error)
+	// Save persists (or overwrites) the online ddl info for one ghost table.
+	Save(tctx *tcontext.Context, id, ghostSchema, ghostTable string, info *GhostDDLInfo) error
+	// Delete removes the online ddl info for one ghost table.
+	Delete(tctx *tcontext.Context, id, ghostSchema, ghostTable string) error
+	// Clear removes all online ddl info for the given source ID.
+	Clear(tctx *tcontext.Context, id string) error
+	// ListEntries returns every recorded entry, across all source IDs this
+	// backend happens to hold, for `admin cleanup online-ddl` style use.
+	ListEntries(tctx *tcontext.Context) ([]MetaEntry, error)
+	// ResetConn resets any underlying connection the backend holds open,
+	// it's a no-op for backends that don't keep one.
+	ResetConn(tctx *tcontext.Context) error
+	// Close releases resources held by the backend.
+	Close()
+}
+
+// MetaStoreOptions carries the backend-specific settings NewMetaStore needs
+// for the kinds that can't be constructed from cfg/schema/tableName alone.
+type MetaStoreOptions struct {
+	// FileDir is the directory NewFileMetaStore writes to; required when
+	// storeKind is "file".
+	FileDir string
+	// EtcdClient is dm-worker's existing connection to the dm-master
+	// cluster; required when storeKind is "etcd".
+	EtcdClient EtcdClient
+	// EtcdPrefix roots the etcd keys NewEtcdMetaStore reads/writes, e.g.
+	// "/dm-worker/online-ddl/<task-name>/"; required when storeKind is
+	// "etcd".
+	EtcdPrefix string
+}
+
+// NewMetaStore builds the MetaStore backend named by storeKind, so that
+// DM can drive the online-ddl-aware sync into a sink that can't host a
+// `*_onlineddl` table at all (Kafka, a file/BR-style export, ...): those
+// deployments want storeKind "memory", "file", or "etcd" instead of the
+// MySQL-table default.
+//
+// storeKind is NOT read from cfg by this function, and nothing in this
+// package derives it from config automatically — it's the caller's job
+// to decide storeKind (e.g. from a future `online-ddl-store` subtask
+// config key) and pass it to Storage.SetMetaStoreKind before Init. That
+// config key doesn't exist on config.SubTaskConfig, and can't be added
+// here: the config package isn't part of this snapshot. "" behaves like
+// "mysql".
+func NewMetaStore(storeKind string, cfg *config.SubTaskConfig, schema, tableName string, logCtx *tcontext.Context, opts MetaStoreOptions) (MetaStore, error) {
+	switch storeKind {
+	case "", "mysql":
+		return newMySQLMetaStore(cfg, schema, tableName, logCtx), nil
+	case "memory":
+		return newMemMetaStore(), nil
+	case "file":
+		if opts.FileDir == "" {
+			return nil, fmt.Errorf("online ddl: online-ddl-store \"file\" requires MetaStoreOptions.FileDir")
+		}
+		return NewFileMetaStore(opts.FileDir), nil
+	case "etcd":
+		if opts.EtcdClient == nil {
+			return nil, fmt.Errorf("online ddl: online-ddl-store \"etcd\" requires MetaStoreOptions.EtcdClient")
+		}
+		return NewEtcdMetaStore(opts.EtcdClient, opts.EtcdPrefix), nil
+	default:
+		return nil, fmt.Errorf("online ddl: unknown online-ddl-store kind %q", storeKind)
+	}
+}
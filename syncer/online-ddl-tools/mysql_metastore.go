@@ -0,0 +1,196 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onlineddl
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pingcap/failpoint"
+
+	"github.com/pingcap/dm/dm/config"
+	"github.com/pingcap/dm/pkg/conn"
+	tcontext "github.com/pingcap/dm/pkg/context"
+	"github.com/pingcap/dm/pkg/terror"
+	"github.com/pingcap/dm/syncer/dbconn"
+)
+
+// mysqlMetaStore is the original MetaStore implementation: it keeps online
+// ddl metadata in a table on the downstream MySQL/TiDB instance. It's the
+// default backend, kept for users who have no other shared storage
+// available.
+type mysqlMetaStore struct {
+	cfg *config.SubTaskConfig
+
+	db        *conn.BaseDB
+	dbConn    *dbconn.DBConn
+	schema    string
+	tableName string
+	logCtx    *tcontext.Context
+}
+
+func newMySQLMetaStore(cfg *config.SubTaskConfig, schema, tableName string, logCtx *tcontext.Context) *mysqlMetaStore {
+	return &mysqlMetaStore{
+		cfg:       cfg,
+		schema:    schema,
+		tableName: tableName,
+		logCtx:    logCtx,
+	}
+}
+
+// Init implements MetaStore.Init.
+func (m *mysqlMetaStore) Init(tctx *tcontext.Context) error {
+	onlineDB := m.cfg.To
+	onlineDB.RawDBCfg = config.DefaultRawDBConfig().SetReadTimeout(maxCheckPointTimeout)
+	db, dbConns, err := dbconn.CreateConns(tctx, m.cfg, onlineDB, 1)
+	if err != nil {
+		return terror.WithScope(err, terror.ScopeDownstream)
+	}
+	m.db = db
+	m.dbConn = dbConns[0]
+
+	if err := m.createSchema(tctx); err != nil {
+		return err
+	}
+	return m.createTable(tctx)
+}
+
+// Load implements MetaStore.Load.
+func (m *mysqlMetaStore) Load(tctx *tcontext.Context, id string) (map[string]map[string]*GhostDDLInfo, error) {
+	ddls := make(map[string]map[string]*GhostDDLInfo)
+
+	query := fmt.Sprintf("SELECT `ghost_schema`, `ghost_table`, `ddls` FROM %s WHERE `id`= ?", m.tableName)
+	rows, err := m.dbConn.QuerySQL(tctx, query, id)
+	if err != nil {
+		return nil, terror.WithScope(err, terror.ScopeDownstream)
+	}
+	defer rows.Close()
+
+	var (
+		schema string
+		table  string
+		raw    string
+	)
+	for rows.Next() {
+		if err := rows.Scan(&schema, &table, &raw); err != nil {
+			return nil, terror.WithScope(terror.DBErrorAdapt(err, terror.ErrDBDriverError), terror.ScopeDownstream)
+		}
+
+		mSchema, ok := ddls[schema]
+		if !ok {
+			mSchema = make(map[string]*GhostDDLInfo)
+			ddls[schema] = mSchema
+		}
+
+		mSchema[table] = &GhostDDLInfo{}
+		if err := json.Unmarshal([]byte(raw), mSchema[table]); err != nil {
+			return nil, terror.ErrSyncerUnitOnlineDDLInvalidMeta.Delegate(err)
+		}
+	}
+
+	return ddls, terror.WithScope(terror.DBErrorAdapt(rows.Err(), terror.ErrDBDriverError), terror.ScopeDownstream)
+}
+
+// ListEntries implements MetaStore.ListEntries.
+func (m *mysqlMetaStore) ListEntries(tctx *tcontext.Context) ([]MetaEntry, error) {
+	query := fmt.Sprintf("SELECT `id`, `ghost_schema`, `ghost_table`, `ddls`, `update_time` FROM %s", m.tableName)
+	rows, err := m.dbConn.QuerySQL(tctx, query)
+	if err != nil {
+		return nil, terror.WithScope(err, terror.ScopeDownstream)
+	}
+	defer rows.Close()
+
+	var entries []MetaEntry
+	var (
+		id, schema, table, raw string
+		updatedAt              time.Time
+	)
+	for rows.Next() {
+		if err := rows.Scan(&id, &schema, &table, &raw, &updatedAt); err != nil {
+			return nil, terror.WithScope(terror.DBErrorAdapt(err, terror.ErrDBDriverError), terror.ScopeDownstream)
+		}
+		info := &GhostDDLInfo{}
+		if err := json.Unmarshal([]byte(raw), info); err != nil {
+			return nil, terror.ErrSyncerUnitOnlineDDLInvalidMeta.Delegate(err)
+		}
+		entries = append(entries, MetaEntry{
+			ID:          id,
+			GhostSchema: schema,
+			GhostTable:  table,
+			Info:        info,
+			UpdatedAt:   updatedAt,
+		})
+	}
+	return entries, terror.WithScope(terror.DBErrorAdapt(rows.Err(), terror.ErrDBDriverError), terror.ScopeDownstream)
+}
+
+// Save implements MetaStore.Save.
+func (m *mysqlMetaStore) Save(tctx *tcontext.Context, id, ghostSchema, ghostTable string, info *GhostDDLInfo) error {
+	ddlsBytes, err := json.Marshal(info)
+	if err != nil {
+		return terror.ErrSyncerUnitOnlineDDLInvalidMeta.Delegate(err)
+	}
+
+	query := fmt.Sprintf("REPLACE INTO %s(`id`,`ghost_schema`, `ghost_table`, `ddls`) VALUES (?, ?, ?, ?)", m.tableName)
+	_, err = m.dbConn.ExecuteSQL(tctx, []string{query}, []interface{}{id, ghostSchema, ghostTable, string(ddlsBytes)})
+	failpoint.Inject("ExitAfterSaveOnlineDDL", func() {
+		tctx.L().Info("failpoint ExitAfterSaveOnlineDDL")
+		panic("ExitAfterSaveOnlineDDL")
+	})
+	return terror.WithScope(err, terror.ScopeDownstream)
+}
+
+// Delete implements MetaStore.Delete.
+func (m *mysqlMetaStore) Delete(tctx *tcontext.Context, id, ghostSchema, ghostTable string) error {
+	sql := fmt.Sprintf("DELETE FROM %s WHERE `id` = ? and `ghost_schema` = ? and `ghost_table` = ?", m.tableName)
+	_, err := m.dbConn.ExecuteSQL(tctx, []string{sql}, []interface{}{id, ghostSchema, ghostTable})
+	return terror.WithScope(err, terror.ScopeDownstream)
+}
+
+// Clear implements MetaStore.Clear.
+func (m *mysqlMetaStore) Clear(tctx *tcontext.Context, id string) error {
+	sql := fmt.Sprintf("DELETE FROM %s WHERE `id` = ?", m.tableName)
+	_, err := m.dbConn.ExecuteSQL(tctx, []string{sql}, []interface{}{id})
+	return terror.WithScope(err, terror.ScopeDownstream)
+}
+
+// ResetConn implements MetaStore.ResetConn.
+func (m *mysqlMetaStore) ResetConn(tctx *tcontext.Context) error {
+	return m.dbConn.ResetConn(tctx)
+}
+
+// Close implements MetaStore.Close.
+func (m *mysqlMetaStore) Close() {
+	dbconn.CloseBaseDB(m.logCtx, m.db)
+}
+
+func (m *mysqlMetaStore) createSchema(tctx *tcontext.Context) error {
+	sql := fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s", m.schema)
+	_, err := m.dbConn.ExecuteSQL(tctx, []string{sql})
+	return terror.WithScope(err, terror.ScopeDownstream)
+}
+
+func (m *mysqlMetaStore) createTable(tctx *tcontext.Context) error {
+	sql := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			id VARCHAR(32) NOT NULL,
+			ghost_schema VARCHAR(128) NOT NULL,
+			ghost_table VARCHAR(128) NOT NULL,
+			ddls text,
+			update_time timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+			UNIQUE KEY uk_id_schema_table (id, ghost_schema, ghost_table)
+		)`, m.tableName)
+	_, err := m.dbConn.ExecuteSQL(tctx, []string{sql})
+	return terror.WithScope(err, terror.ScopeDownstream)
+}
@@ -14,18 +14,12 @@
 package onlineddl
 
 import (
-	"encoding/json"
-	"fmt"
 	"sync"
-
-	"github.com/pingcap/failpoint"
+	"time"
 
 	"github.com/pingcap/dm/dm/config"
-	"github.com/pingcap/dm/pkg/conn"
 	tcontext "github.com/pingcap/dm/pkg/context"
 	"github.com/pingcap/dm/pkg/cputil"
-	"github.com/pingcap/dm/pkg/terror"
-	"github.com/pingcap/dm/syncer/dbconn"
 
 	"github.com/pingcap/parser/ast"
 	"github.com/pingcap/tidb-tools/pkg/dbutil"
@@ -54,6 +48,13 @@ type OnlinePlugin interface {
 	Apply(tctx *tcontext.Context, tables []*filter.Table, statement string, stmt ast.StmtNode) ([]string, string, string, error)
 	// Finish would delete online ddl from memory and storage
 	Finish(tctx *tcontext.Context, schema, table string) error
+	// HandleHook is called when gh-ost/pt-osc invokes one of its lifecycle
+	// hooks (onStartup/onBeforeCutOver/onSuccess/onFailure). Implementations
+	// should record the payload so that TableType/Apply can treat it as an
+	// authoritative source instead of inferring the table's role from its
+	// name, which removes the race where DM has to replay DDL from the
+	// binlog before the upstream cutover is actually done.
+	HandleHook(tctx *tcontext.Context, payload HookPayload) error
 	// TableType returns ghhost/real table
 	TableType(table string) TableType
 	// RealName returns real table name that removed ghost suffix and handled by table router
@@ -67,6 +68,10 @@ type OnlinePlugin interface {
 	Close()
 	// CheckAndUpdate try to check and fix the schema/table case-sensitive issue
 	CheckAndUpdate(tctx *tcontext.Context, schemas map[string]string, tables map[string]map[string]string) error
+	// Cleanup removes online-ddl metadata left behind by a gh-ost/pt-osc
+	// run that crashed mid-migration, see Storage.CleanupStale. Backing
+	// `admin cleanup online-ddl` / dmctl.
+	Cleanup(tctx *tcontext.Context, olderThan time.Duration, schemas []string, dryRun bool) ([]CleanedEntry, error)
 }
 
 // TableType is type of table.
@@ -85,16 +90,32 @@ type GhostDDLInfo struct {
 	Table  string `json:"table"`
 
 	DDLs []string `json:"ddls"`
+
+	// Version is the schema version of this record, bumped whenever the
+	// on-disk/wire shape of GhostDDLInfo changes. Rows written before this
+	// field existed unmarshal with the Go zero value, so they're treated
+	// as v0 without any explicit migration step.
+	Version int `json:"version"`
+
+	// HookContextID is the HookPayload.ContextID that created this entry
+	// via EnsureGhostEntry, if any. It lets a later onStartup hook tell a
+	// repeated call for the same gh-ost/pt-osc run apart from a new run
+	// that crashed and restarted reusing the same ghost table name.
+	HookContextID string `json:"hook_context_id,omitempty"`
 }
 
+// ghostDDLInfoVersion is the version written for newly Saved records.
+const ghostDDLInfoVersion = 1
+
 // Storage stores sharding group online ddls information.
 type Storage struct {
 	sync.RWMutex
 
 	cfg *config.SubTaskConfig
 
-	db        *conn.BaseDB
-	dbConn    *dbconn.DBConn
+	store     MetaStore // persistence backend, built by NewMetaStore unless SetMetaStore is called
+	storeKind string    // backend kind passed to NewMetaStore, see SetMetaStoreKind
+	storeOpts MetaStoreOptions
 	schema    string // schema name, set through task config
 	tableName string // table name with schema, now it's task name
 	id        string // the source ID of the upstream MySQL/MariaDB replica.
@@ -102,6 +123,13 @@ type Storage struct {
 	// map ghost schema => [ghost table => ghost ddl info, ...]
 	ddls map[string]map[string]*GhostDDLInfo
 
+	// hooks records the state delivered by gh-ost/pt-osc hook calls, see
+	// RecordHook/HookState in hook.go.
+	hooks *hookState
+
+	// sched serializes Apply jobs per real table, see scheduler.go.
+	sched *tableScheduler
+
 	logCtx *tcontext.Context
 }
 
@@ -113,25 +141,49 @@ func NewOnlineDDLStorage(logCtx *tcontext.Context, cfg *config.SubTaskConfig) *S
 		tableName: dbutil.TableName(cfg.MetaSchema, cputil.SyncerOnlineDDL(cfg.Name)),
 		id:        cfg.SourceID,
 		ddls:      make(map[string]map[string]*GhostDDLInfo),
+		hooks:     newHookState(),
+		sched:     newTableScheduler(),
 		logCtx:    logCtx,
 	}
 
 	return s
 }
 
+// SetMetaStore overrides the persistence backend used for online ddl
+// metadata directly. It must be called before Init; without a call, Init
+// builds one via NewMetaStore from the kind set by SetMetaStoreKind (the
+// MySQL-table backend, by default). dmctl and embedded callers that have
+// no writable downstream can pass a file-backed or etcd-backed MetaStore
+// instead.
+func (s *Storage) SetMetaStore(store MetaStore) {
+	s.store = store
+}
+
+// SetMetaStoreKind picks the backend Init builds via NewMetaStore by kind
+// instead of requiring the caller to construct a MetaStore by hand. This
+// is NOT config-driven yet: nothing calls it automatically from
+// cfg/config.SubTaskConfig, so the caller (dm-worker's subtask startup,
+// once it exists in this tree) must still read whatever config key picks
+// the backend itself and pass the result here before Init. Wiring that
+// read into config.SubTaskConfig is out of scope for this change: that
+// package lives outside this snapshot, so no field can be added to it
+// here. "" keeps the default MySQL-table backend.
+func (s *Storage) SetMetaStoreKind(kind string, opts MetaStoreOptions) {
+	s.storeKind = kind
+	s.storeOpts = opts
+}
+
 // Init initials online handler.
 func (s *Storage) Init(tctx *tcontext.Context) error {
-	onlineDB := s.cfg.To
-	onlineDB.RawDBCfg = config.DefaultRawDBConfig().SetReadTimeout(maxCheckPointTimeout)
-	db, dbConns, err := dbconn.CreateConns(tctx, s.cfg, onlineDB, 1)
-	if err != nil {
-		return terror.WithScope(err, terror.ScopeDownstream)
+	if s.store == nil {
+		store, err := NewMetaStore(s.storeKind, s.cfg, s.schema, s.tableName, s.logCtx, s.storeOpts)
+		if err != nil {
+			return err
+		}
+		s.store = store
 	}
-	s.db = db
-	s.dbConn = dbConns[0]
 
-	err = s.prepare(tctx)
-	if err != nil {
+	if err := s.store.Init(tctx); err != nil {
 		return err
 	}
 
@@ -143,41 +195,21 @@ func (s *Storage) Load(tctx *tcontext.Context) error {
 	s.Lock()
 	defer s.Unlock()
 
-	query := fmt.Sprintf("SELECT `ghost_schema`, `ghost_table`, `ddls` FROM %s WHERE `id`= ?", s.tableName)
-	rows, err := s.dbConn.QuerySQL(tctx, query, s.id)
+	ddls, err := s.store.Load(tctx, s.id)
 	if err != nil {
-		return terror.WithScope(err, terror.ScopeDownstream)
+		return err
 	}
-	defer rows.Close()
-
-	var (
-		schema string
-		table  string
-		ddls   string
-	)
-	for rows.Next() {
-		err := rows.Scan(&schema, &table, &ddls)
-		if err != nil {
-			return terror.WithScope(terror.DBErrorAdapt(err, terror.ErrDBDriverError), terror.ScopeDownstream)
-		}
+	s.ddls = ddls
 
-		mSchema, ok := s.ddls[schema]
-		if !ok {
-			mSchema = make(map[string]*GhostDDLInfo)
-			s.ddls[schema] = mSchema
+	for schema, tbls := range ddls {
+		for table := range tbls {
+			tctx.L().Info("loaded online ddl meta from checkpoint",
+				zap.String("db", schema),
+				zap.String("table", table))
 		}
-
-		mSchema[table] = &GhostDDLInfo{}
-		err = json.Unmarshal([]byte(ddls), mSchema[table])
-		if err != nil {
-			return terror.ErrSyncerUnitOnlineDDLInvalidMeta.Delegate(err)
-		}
-		tctx.L().Info("loaded online ddl meta from checkpoint",
-			zap.String("db", schema),
-			zap.String("table", table))
 	}
 
-	return terror.WithScope(terror.DBErrorAdapt(rows.Err(), terror.ErrDBDriverError), terror.ScopeDownstream)
+	return nil
 }
 
 // Get returns ddls by given schema/table.
@@ -200,10 +232,24 @@ func (s *Storage) Get(ghostSchema, ghostTable string) *GhostDDLInfo {
 	return clone
 }
 
-// Save saves online ddl information.
-func (s *Storage) Save(tctx *tcontext.Context, ghostSchema, ghostTable, realSchema, realTable, ddl string) error {
+// Save saves online ddl information. scheme (config.PT or config.GHOST)
+// identifies which plugin is driving (realSchema, realTable); Save blocks
+// until any other job already running against that real table finishes,
+// and fails fast instead of blocking if a different scheme is already
+// working it, see Storage.BeginTableJob.
+//
+// The persister write (s.store.Save, the slow part: a DB/etcd/file round
+// trip) runs outside the Storage-wide mutex, guarded only by the
+// table-scoped slot BeginTableJob reserved, so a long write for table A
+// doesn't stall Get/Save/Delete for table B.
+func (s *Storage) Save(tctx *tcontext.Context, scheme, ghostSchema, ghostTable, realSchema, realTable, ddl string) error {
+	release, err := s.BeginTableJob(scheme, realSchema, realTable)
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	s.Lock()
-	defer s.Unlock()
 
 	mSchema, ok := s.ddls[ghostSchema]
 	if !ok {
@@ -214,8 +260,9 @@ func (s *Storage) Save(tctx *tcontext.Context, ghostSchema, ghostTable, realSche
 	info, ok := mSchema[ghostTable]
 	if !ok {
 		info = &GhostDDLInfo{
-			Schema: realSchema,
-			Table:  realTable,
+			Schema:  realSchema,
+			Table:   realTable,
+			Version: ghostDDLInfoVersion,
 		}
 		mSchema[ghostTable] = info
 	}
@@ -223,27 +270,19 @@ func (s *Storage) Save(tctx *tcontext.Context, ghostSchema, ghostTable, realSche
 	// maybe we meed more checks for it
 
 	if len(info.DDLs) != 0 && info.DDLs[len(info.DDLs)-1] == ddl {
+		s.Unlock()
 		tctx.L().Warn("online ddl may be saved before, just ignore it", zap.String("ddl", ddl))
 		return nil
 	}
 	info.DDLs = append(info.DDLs, ddl)
-	err := s.saveToDB(tctx, ghostSchema, ghostTable, info)
-	return terror.WithScope(err, terror.ScopeDownstream)
-}
-
-func (s *Storage) saveToDB(tctx *tcontext.Context, ghostSchema, ghostTable string, ddl *GhostDDLInfo) error {
-	ddlsBytes, err := json.Marshal(ddl)
-	if err != nil {
-		return terror.ErrSyncerUnitOnlineDDLInvalidMeta.Delegate(err)
-	}
-
-	query := fmt.Sprintf("REPLACE INTO %s(`id`,`ghost_schema`, `ghost_table`, `ddls`) VALUES (?, ?, ?, ?)", s.tableName)
-	_, err = s.dbConn.ExecuteSQL(tctx, []string{query}, []interface{}{s.id, ghostSchema, ghostTable, string(ddlsBytes)})
-	failpoint.Inject("ExitAfterSaveOnlineDDL", func() {
-		tctx.L().Info("failpoint ExitAfterSaveOnlineDDL")
-		panic("ExitAfterSaveOnlineDDL")
-	})
-	return terror.WithScope(err, terror.ScopeDownstream)
+	// toSave is a copy taken under the lock, so the store write below reads
+	// a stable value even if info is changed in place (by a later Save or by
+	// CheckAndUpdate) after unlocking.
+	toSave := new(GhostDDLInfo)
+	*toSave = *info
+	s.Unlock()
+
+	return s.store.Save(tctx, s.id, ghostSchema, ghostTable, toSave)
 }
 
 // Delete deletes online ddl informations.
@@ -259,11 +298,8 @@ func (s *Storage) delete(tctx *tcontext.Context, ghostSchema, ghostTable string)
 		return nil
 	}
 
-	// delete all checkpoints
-	sql := fmt.Sprintf("DELETE FROM %s WHERE `id` = ? and `ghost_schema` = ? and `ghost_table` = ?", s.tableName)
-	_, err := s.dbConn.ExecuteSQL(tctx, []string{sql}, []interface{}{s.id, ghostSchema, ghostTable})
-	if err != nil {
-		return terror.WithScope(err, terror.ScopeDownstream)
+	if err := s.store.Delete(tctx, s.id, ghostSchema, ghostTable); err != nil {
+		return err
 	}
 
 	delete(mSchema, ghostTable)
@@ -275,11 +311,8 @@ func (s *Storage) Clear(tctx *tcontext.Context) error {
 	s.Lock()
 	defer s.Unlock()
 
-	// delete all checkpoints
-	sql := fmt.Sprintf("DELETE FROM %s WHERE `id` = ?", s.tableName)
-	_, err := s.dbConn.ExecuteSQL(tctx, []string{sql}, []interface{}{s.id})
-	if err != nil {
-		return terror.WithScope(err, terror.ScopeDownstream)
+	if err := s.store.Clear(tctx, s.id); err != nil {
+		return err
 	}
 
 	s.ddls = make(map[string]map[string]*GhostDDLInfo)
@@ -288,7 +321,7 @@ func (s *Storage) Clear(tctx *tcontext.Context) error {
 
 // ResetConn implements OnlinePlugin.ResetConn.
 func (s *Storage) ResetConn(tctx *tcontext.Context) error {
-	return s.dbConn.ResetConn(tctx)
+	return s.store.ResetConn(tctx)
 }
 
 // Close closes database connection.
@@ -296,34 +329,7 @@ func (s *Storage) Close() {
 	s.Lock()
 	defer s.Unlock()
 
-	dbconn.CloseBaseDB(s.logCtx, s.db)
-}
-
-func (s *Storage) prepare(tctx *tcontext.Context) error {
-	if err := s.createSchema(tctx); err != nil {
-		return err
-	}
-
-	return s.createTable(tctx)
-}
-
-func (s *Storage) createSchema(tctx *tcontext.Context) error {
-	sql := fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s", s.schema)
-	_, err := s.dbConn.ExecuteSQL(tctx, []string{sql})
-	return terror.WithScope(err, terror.ScopeDownstream)
-}
-
-func (s *Storage) createTable(tctx *tcontext.Context) error {
-	sql := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
-			id VARCHAR(32) NOT NULL,
-			ghost_schema VARCHAR(128) NOT NULL,
-			ghost_table VARCHAR(128) NOT NULL,
-			ddls text,
-			update_time timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
-			UNIQUE KEY uk_id_schema_table (id, ghost_schema, ghost_table)
-		)`, s.tableName)
-	_, err := s.dbConn.ExecuteSQL(tctx, []string{sql})
-	return terror.WithScope(err, terror.ScopeDownstream)
+	s.store.Close()
 }
 
 // CheckAndUpdate try to check and fix the schema/table case-sensitive issue.
@@ -354,7 +360,7 @@ func (s *Storage) CheckAndUpdate(
 			if tableChange {
 				targetTable := realNameFn(realTbl)
 				ddlInfos.Table = targetTable
-				err := s.saveToDB(tctx, realSchema, realTbl, ddlInfos)
+				err := s.store.Save(tctx, s.id, realSchema, realTbl, ddlInfos)
 				if err != nil {
 					return err
 				}
@@ -0,0 +1,155 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onlineddl
+
+import (
+	"fmt"
+	"sync"
+)
+
+// tableJobQueue serializes Apply calls that touch the same real
+// (schema, table), while letting unrelated tables run concurrently: one
+// long gh-ost RENAME cutover on table A no longer stalls table B.
+type tableJobQueue struct {
+	// execMu is held for the duration of one Apply call on this table, so
+	// jobs on the same table run one at a time. It is a plain sync.Mutex:
+	// callers waiting on it are not guaranteed to get it in the order they
+	// started waiting.
+	execMu sync.Mutex
+
+	stateMu  sync.Mutex
+	owner    string // scheme (config.PT/config.GHOST) currently working this table, "" if free
+	queued   int
+	inFlight int
+}
+
+// tableScheduler is a per-(realSchema, realTable) dependency tracker for
+// onlineddl.Storage, modelled after TiDB's ddl_running_jobs: instead of one
+// lock serializing every Apply in the subtask, each real table gets its
+// own queue.
+type tableScheduler struct {
+	mu     sync.Mutex
+	tables map[string]*tableJobQueue
+}
+
+func newTableScheduler() *tableScheduler {
+	return &tableScheduler{tables: make(map[string]*tableJobQueue)}
+}
+
+func schedulerKey(realSchema, realTable string) string {
+	return realSchema + "." + realTable
+}
+
+func (ts *tableScheduler) queueFor(realSchema, realTable string) *tableJobQueue {
+	key := schedulerKey(realSchema, realTable)
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	tq, ok := ts.tables[key]
+	if !ok {
+		tq = &tableJobQueue{}
+		ts.tables[key] = tq
+	}
+	return tq
+}
+
+// Begin reserves the right to run an Apply job against (realSchema,
+// realTable) on behalf of scheme (config.PT or config.GHOST), blocking
+// until any job already in flight for that table finishes. It fails fast,
+// without waiting, if a different scheme already owns the table: PT and
+// GHOST racing on the same real table is a misconfiguration, not something
+// to silently serialize.
+//
+// The caller must invoke the returned release func exactly once, typically
+// via defer, once its Apply call (and the Storage.Save that records it)
+// has completed.
+func (ts *tableScheduler) Begin(scheme, realSchema, realTable string) (release func(), err error) {
+	tq := ts.queueFor(realSchema, realTable)
+
+	tq.stateMu.Lock()
+	if tq.owner != "" && tq.owner != scheme {
+		owner := tq.owner
+		tq.stateMu.Unlock()
+		return nil, fmt.Errorf("online ddl: table `%s`.`%s` is already being migrated by %s, refusing conflicting %s job",
+			realSchema, realTable, owner, scheme)
+	}
+	tq.owner = scheme
+	tq.queued++
+	tq.stateMu.Unlock()
+
+	tq.execMu.Lock()
+
+	tq.stateMu.Lock()
+	tq.queued--
+	tq.inFlight++
+	tq.stateMu.Unlock()
+
+	released := false
+	release = func() {
+		if released {
+			return
+		}
+		released = true
+
+		tq.stateMu.Lock()
+		tq.inFlight--
+		if tq.queued == 0 && tq.inFlight == 0 {
+			tq.owner = ""
+		}
+		tq.stateMu.Unlock()
+
+		tq.execMu.Unlock()
+	}
+	return release, nil
+}
+
+// SchedulerTableMetric is a point-in-time snapshot of one table's queue,
+// for exporting as a gauge.
+type SchedulerTableMetric struct {
+	Owner    string
+	Queued   int
+	InFlight int
+}
+
+// Metrics returns a snapshot of every table the scheduler currently knows
+// about (including ones that have gone idle but haven't been forgotten).
+func (ts *tableScheduler) Metrics() map[string]SchedulerTableMetric {
+	ts.mu.Lock()
+	tables := make(map[string]*tableJobQueue, len(ts.tables))
+	for k, v := range ts.tables {
+		tables[k] = v
+	}
+	ts.mu.Unlock()
+
+	metrics := make(map[string]SchedulerTableMetric, len(tables))
+	for k, tq := range tables {
+		tq.stateMu.Lock()
+		metrics[k] = SchedulerTableMetric{Owner: tq.owner, Queued: tq.queued, InFlight: tq.inFlight}
+		tq.stateMu.Unlock()
+	}
+	return metrics
+}
+
+// BeginTableJob reserves Storage's per-table scheduler slot for
+// (realSchema, realTable), see tableScheduler.Begin.
+func (s *Storage) BeginTableJob(scheme, realSchema, realTable string) (func(), error) {
+	return s.sched.Begin(scheme, realSchema, realTable)
+}
+
+// SchedulerMetrics exposes the current per-table queue depths/in-flight
+// counts, so they can be registered as prometheus gauges by whoever embeds
+// Storage (dm-worker's metrics package isn't part of this snapshot).
+func (s *Storage) SchedulerMetrics() map[string]SchedulerTableMetric {
+	return s.sched.Metrics()
+}
@@ -0,0 +1,103 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onlineddl
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pingcap/dm/dm/config"
+)
+
+func TestTableSchedulerFailsFastOnConflictingScheme(t *testing.T) {
+	ts := newTableScheduler()
+
+	release, err := ts.Begin(config.GHOST, "db1", "t1")
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+
+	if _, err := ts.Begin(config.PT, "db1", "t1"); err == nil {
+		t.Fatal("expected Begin to fail fast for a conflicting scheme on the same real table")
+	}
+
+	release()
+
+	// once released, a different scheme may take the table over.
+	release2, err := ts.Begin(config.PT, "db1", "t1")
+	if err != nil {
+		t.Fatalf("Begin after release: %v", err)
+	}
+	release2()
+}
+
+func TestTableSchedulerRunsAllJobsOnSameTable(t *testing.T) {
+	ts := newTableScheduler()
+
+	const jobs = 20
+	var mu sync.Mutex
+	var order []int
+	var wg sync.WaitGroup
+
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			release, err := ts.Begin(config.GHOST, "db1", "t1")
+			if err != nil {
+				t.Errorf("Begin: %v", err)
+				return
+			}
+			defer release()
+
+			mu.Lock()
+			order = append(order, i)
+			mu.Unlock()
+		}(i)
+	}
+	wg.Wait()
+
+	if len(order) != jobs {
+		t.Fatalf("expected %d jobs to have run, got %d", jobs, len(order))
+	}
+}
+
+func TestTableSchedulerDoesNotBlockUnrelatedTables(t *testing.T) {
+	ts := newTableScheduler()
+
+	releaseA, err := ts.Begin(config.GHOST, "db1", "t1")
+	if err != nil {
+		t.Fatalf("Begin t1: %v", err)
+	}
+	defer releaseA()
+
+	done := make(chan error, 1)
+	go func() {
+		releaseB, err := ts.Begin(config.GHOST, "db1", "t2")
+		if err == nil {
+			releaseB()
+		}
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Begin t2: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Begin on an unrelated table was blocked by an in-flight job on another table")
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2019 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onlineddl
+
+import (
+	"testing"
+
+	tcontext "github.com/pingcap/dm/pkg/context"
+	"github.com/pingcap/dm/pkg/log"
+)
+
+func newSnapshotTestStorage(t *testing.T) *Storage {
+	t.Helper()
+	logCtx := tcontext.NewContext(nil, log.L())
+	return &Storage{
+		ddls:   make(map[string]map[string]*GhostDDLInfo),
+		logCtx: logCtx,
+	}
+}
+
+// TestSnapshotRestoreRoundTrip checks that Restore(Snapshot()) reproduces
+// the in-memory state exactly.
+func TestSnapshotRestoreRoundTrip(t *testing.T) {
+	s := newSnapshotTestStorage(t)
+	s.ddls["ghost_db"] = map[string]*GhostDDLInfo{
+		"_t1_gho": {Schema: "real_db", Table: "t1", DDLs: []string{"ALTER TABLE t1 ADD COLUMN c1 INT"}, Version: ghostDDLInfoVersion},
+	}
+
+	snap, err := s.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+
+	restored := newSnapshotTestStorage(t)
+	if err := restored.Restore(snap); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+
+	info := restored.Get("ghost_db", "_t1_gho")
+	if info == nil {
+		t.Fatal("expected restored state to contain the snapshotted entry")
+	}
+	if info.Schema != "real_db" || info.Table != "t1" || len(info.DDLs) != 1 || info.DDLs[0] != "ALTER TABLE t1 ADD COLUMN c1 INT" {
+		t.Fatalf("restored entry does not match the original: %+v", info)
+	}
+}
+
+// TestRestoreAcceptsPreVersionSnapshot decodes a snapshot shaped like one
+// taken before GhostDDLInfo.Version existed, and confirms it's accepted
+// as v0 rather than rejected.
+func TestRestoreAcceptsPreVersionSnapshot(t *testing.T) {
+	raw := []byte(`{
+		"version": 1,
+		"ddls": {
+			"ghost_db": {
+				"_t1_gho": {"schema": "real_db", "table": "t1", "ddls": ["ALTER TABLE t1 ADD COLUMN c1 INT"]}
+			}
+		}
+	}`)
+
+	s := newSnapshotTestStorage(t)
+	if err := s.Restore(raw); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+
+	info := s.Get("ghost_db", "_t1_gho")
+	if info == nil {
+		t.Fatal("expected the pre-Version entry to be restored")
+	}
+	if info.Version != 0 {
+		t.Fatalf("expected a pre-Version entry to decode as v0, got %d", info.Version)
+	}
+	if info.Schema != "real_db" || info.Table != "t1" {
+		t.Fatalf("unexpected restored entry: %+v", info)
+	}
+}
+
+// TestRestoreGarbageBytesDoesNotCorruptState confirms Restore on
+// unparseable bytes returns an error and leaves the existing in-memory
+// state untouched instead of partially overwriting it.
+func TestRestoreGarbageBytesDoesNotCorruptState(t *testing.T) {
+	s := newSnapshotTestStorage(t)
+	s.ddls["ghost_db"] = map[string]*GhostDDLInfo{
+		"_t1_gho": {Schema: "real_db", Table: "t1"},
+	}
+
+	if err := s.Restore([]byte("not valid json")); err == nil {
+		t.Fatal("expected Restore to reject garbage bytes")
+	}
+
+	info := s.Get("ghost_db", "_t1_gho")
+	if info == nil || info.Schema != "real_db" {
+		t.Fatalf("expected existing state to survive a failed Restore, got %+v", info)
+	}
+}